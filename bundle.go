@@ -0,0 +1,353 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"go/ast"
+	"go/token"
+	"go/types"
+	"strings"
+
+	"rsc.io/rf/refactor"
+)
+
+// cmdBundle implements the bundle command.
+//
+// Usage:
+//
+//	bundle src=path dst=file [prefix=prefix]
+//
+// Bundle copies every exported top-level declaration of the src package
+// into the dst file, renaming each declaration (and every reference to it,
+// both within the copied code and at call sites elsewhere) by prepending
+// prefix. Qualified selectors of the form pkg.Name that refer to src are
+// rewritten to the prefixed identifier wherever they appear in the
+// snapshot's target packages, and the import of src is dropped from dst
+// once it is no longer needed there. Bundle reports an error, rather than
+// producing code that fails to compile, if a copied declaration still
+// needs an unexported sibling that bundle did not also copy.
+func cmdBundle(snap *refactor.Snapshot, text string) {
+	var src, dst, prefix string
+	for _, f := range strings.Fields(text) {
+		key, val, ok := cut(f, "=")
+		if !ok {
+			snap.ErrorAt(token.NoPos, "usage: bundle src=path dst=file [prefix=prefix]")
+			return
+		}
+		switch key {
+		case "src":
+			src = val
+		case "dst":
+			dst = val
+		case "prefix":
+			prefix = val
+		default:
+			snap.ErrorAt(token.NoPos, "unknown bundle option %q", key)
+			return
+		}
+	}
+	if src == "" || dst == "" {
+		snap.ErrorAt(token.NoPos, "usage: bundle src=path dst=file [prefix=prefix]")
+		return
+	}
+
+	srcPkg := snap.Package(src)
+	if srcPkg == nil {
+		snap.ErrorAt(token.NoPos, "cannot find package %s", src)
+		return
+	}
+	dstFile := snap.FileByName(dst)
+	if dstFile == nil {
+		snap.ErrorAt(token.NoPos, "cannot find destination file %s", dst)
+		return
+	}
+
+	b := &bundler{snap: snap, srcPkg: srcPkg, prefix: prefix, renamed: make(map[types.Object]string)}
+	b.collectDecls()
+	if snap.Errors() > 0 {
+		return
+	}
+	b.rewriteSelectors()
+	for _, decl := range b.decls {
+		snap.InsertDecl(dstFile, decl)
+	}
+	snap.DeleteImport(dstFile, srcPkg.PkgPath)
+}
+
+// bundler carries the state needed to copy srcPkg's exported declarations
+// into a destination file, renaming as it goes.
+type bundler struct {
+	snap    *refactor.Snapshot
+	srcPkg  *refactor.Package
+	prefix  string
+	decls   []ast.Decl
+	renamed map[types.Object]string // src object -> prefixed name
+	pending []ast.Decl              // non-method decls, named and awaiting cloning
+}
+
+// collectDecls gathers every exported top-level declaration in srcPkg and
+// records its prefixed name, then clones each one for re-insertion,
+// renaming both its own name and any reference it makes to a sibling
+// declaration that was also renamed. Non-method declarations are
+// normalized with splitDecl to one name per declaration first, so a
+// grouped const/var block doesn't need a multi-name prefixing scheme.
+// Naming happens in its own pass, before any cloning, so that a decl
+// referring to another one declared later in the file still resolves:
+// Go allows forward references within a package. Methods are collected
+// last, once every type's renamed name is known, since a method moves
+// with its receiver type rather than being renamed itself.
+func (b *bundler) collectDecls() {
+	var methods []*ast.FuncDecl
+	for _, file := range b.srcPkg.Files {
+		for _, decl := range file.Syntax.Decls {
+			if fn, ok := decl.(*ast.FuncDecl); ok && fn.Recv != nil {
+				methods = append(methods, fn)
+				continue
+			}
+			for _, one := range b.splitDecl(decl) {
+				name, obj := declName(b.srcPkg, one)
+				if name == "" || obj == nil || !ast.IsExported(name) {
+					continue
+				}
+				b.renamed[obj] = b.prefix + name
+				b.pending = append(b.pending, one)
+			}
+		}
+	}
+	for _, one := range b.pending {
+		_, obj := declName(b.srcPkg, one)
+		clone := refactor.Clone(one).(ast.Decl)
+		renameDecl(clone, b.renamed[obj])
+		b.renameInternalRefs(one, clone)
+		b.decls = append(b.decls, clone)
+	}
+	for _, fn := range methods {
+		b.collectMethod(fn)
+	}
+}
+
+// renameInternalRefs renames every identifier in clone whose counterpart
+// in orig, the declaration clone was cloned from, resolves through
+// srcPkg.Info.Uses to an object that collectDecls also renamed - for
+// example src's Foo calling a sibling Bar by its bare, same-package name.
+// Info.Uses is keyed by orig's own *ast.Ident nodes, so orig and clone
+// must be walked together, in the same order Clone produced clone in, to
+// line each identifier up with its renamed copy.
+//
+// If orig instead refers to one of srcPkg's own top-level objects that
+// was not renamed - necessarily unexported, or an exported decl that
+// splitDecl already rejected - that object was never copied into dst
+// either, so the reference would be left dangling; renameInternalRefs
+// reports an error for it instead, the way collectMethod already does
+// for an exported method whose receiver type wasn't bundled.
+func (b *bundler) renameInternalRefs(orig, clone ast.Decl) {
+	name, _ := declName(b.srcPkg, orig)
+	origIdents := identsIn(orig)
+	cloneIdents := identsIn(clone)
+	for i, id := range origIdents {
+		obj := b.srcPkg.Info.Uses[id]
+		if newName, ok := b.renamed[obj]; ok {
+			cloneIdents[i].Name = newName
+			continue
+		}
+		if isPackageLevelDecl(b.srcPkg, obj) {
+			b.snap.ErrorAt(id.Pos(), "bundle: %s references %s, which bundle did not copy into dst", name, id.Name)
+		}
+	}
+}
+
+// isPackageLevelDecl reports whether obj is itself one of srcPkg's
+// top-level declarations, as opposed to a local variable, a parameter, a
+// builtin, or an object belonging to some other package.
+func isPackageLevelDecl(srcPkg *refactor.Package, obj types.Object) bool {
+	return obj != nil && obj.Pkg() == srcPkg.Types && obj.Parent() == srcPkg.Types.Scope()
+}
+
+// identsIn returns every *ast.Ident in decl, in ast.Inspect's traversal order.
+func identsIn(decl ast.Node) []*ast.Ident {
+	var idents []*ast.Ident
+	ast.Inspect(decl, func(n ast.Node) bool {
+		if id, ok := n.(*ast.Ident); ok {
+			idents = append(idents, id)
+		}
+		return true
+	})
+	return idents
+}
+
+// splitDecl normalizes decl into one declaration per introduced name, so
+// that collectDecls and renameDecl never have to invent a prefixing
+// scheme for a decl that introduces more than one identifier. A
+// multi-name ValueSpec (var a, b = f()) whose names share values from a
+// single multi-valued expression cannot be split without changing its
+// meaning; if that spec exports any name, splitDecl reports an error
+// instead of silently dropping it. Likewise a ConstSpec with no
+// expression list of its own - the iota-style const ( A = iota; B; C )
+// - only means what it does textually inside its enclosing block, which
+// splitDecl is about to take it out of, so the same error is reported
+// for it instead of emitting a standalone const whose value is silently
+// lost.
+func (b *bundler) splitDecl(decl ast.Decl) []ast.Decl {
+	gen, ok := decl.(*ast.GenDecl)
+	if !ok {
+		return []ast.Decl{decl}
+	}
+	var out []ast.Decl
+	for _, spec := range gen.Specs {
+		switch s := spec.(type) {
+		case *ast.TypeSpec:
+			out = append(out, &ast.GenDecl{Tok: gen.Tok, Specs: []ast.Spec{s}})
+		case *ast.ValueSpec:
+			if gen.Tok == token.CONST && len(s.Values) == 0 && spec != gen.Specs[0] {
+				for _, name := range s.Names {
+					if ast.IsExported(name.Name) {
+						b.snap.ErrorAt(s.Pos(), "bundle: cannot split %s: its value is inherited from an earlier spec in the same const block", name.Name)
+						break
+					}
+				}
+				continue
+			}
+			if len(s.Names) <= 1 || len(s.Values) == len(s.Names) || len(s.Values) == 0 {
+				for i, name := range s.Names {
+					one := &ast.ValueSpec{Names: []*ast.Ident{name}, Type: s.Type}
+					if i < len(s.Values) {
+						one.Values = []ast.Expr{s.Values[i]}
+					}
+					out = append(out, &ast.GenDecl{Tok: gen.Tok, Specs: []ast.Spec{one}})
+				}
+				continue
+			}
+			for _, name := range s.Names {
+				if ast.IsExported(name.Name) {
+					b.snap.ErrorAt(s.Pos(), "bundle: cannot split %s: its names share values from a single multi-valued expression", name.Name)
+					break
+				}
+			}
+		}
+	}
+	return out
+}
+
+// collectMethod clones fn's declaration into the destination, renaming
+// its receiver type to match the renamed copy of that type created by
+// collectDecls. A method's own name is left alone: callers reach it
+// through the receiver value, not a package-qualified selector, so
+// there is no call site to rewrite for the method name itself.
+func (b *bundler) collectMethod(fn *ast.FuncDecl) {
+	if !ast.IsExported(fn.Name.Name) {
+		return // src's unexported methods have no external callers to preserve
+	}
+
+	ident := recvIdent(fn.Recv.List[0].Type)
+	obj, _ := b.srcPkg.Info.Uses[ident].(*types.TypeName)
+	newName, ok := b.renamed[obj]
+	if !ok {
+		b.snap.ErrorAt(fn.Pos(), "bundle: %s has exported method %s but its receiver type was not bundled", recvTypeName(fn), fn.Name.Name)
+		return
+	}
+
+	clone := refactor.Clone(fn).(*ast.FuncDecl)
+	recvIdent(clone.Recv.List[0].Type).Name = newName
+	b.renameInternalRefs(fn, clone)
+	b.decls = append(b.decls, clone)
+}
+
+// recvIdent returns the *ast.Ident naming a receiver's type, unwrapping
+// a leading pointer (func (r *Foo) M() -> Foo) or a single type
+// parameter (func (r Foo[T]) M() -> Foo), or nil for any other receiver
+// (for example *Foo[T], or Foo[K, V] with several type parameters).
+func recvIdent(expr ast.Expr) *ast.Ident {
+	switch t := expr.(type) {
+	case *ast.Ident:
+		return t
+	case *ast.StarExpr:
+		if id, ok := t.X.(*ast.Ident); ok {
+			return id
+		}
+	case *ast.IndexExpr:
+		if id, ok := t.X.(*ast.Ident); ok {
+			return id
+		}
+	}
+	return nil
+}
+
+// recvTypeName returns the receiver type name of fn for use in error
+// messages, without the generality recvIdent needs for renaming.
+func recvTypeName(fn *ast.FuncDecl) string {
+	if id := recvIdent(fn.Recv.List[0].Type); id != nil {
+		return id.Name
+	}
+	return "<unknown receiver type>"
+}
+
+// rewriteSelectors rewrites every srcPkg.Name reference in the snapshot's
+// target packages to the prefixed identifier introduced by collectDecls,
+// so that callers of the bundled package keep compiling once src is
+// later removed by a follow-on rm step.
+func (b *bundler) rewriteSelectors() {
+	for _, pkg := range b.snap.TargetPackages() {
+		for _, file := range pkg.Files {
+			ast.Inspect(file.Syntax, func(n ast.Node) bool {
+				sel, ok := n.(*ast.SelectorExpr)
+				if !ok {
+					return true
+				}
+				id, ok := sel.X.(*ast.Ident)
+				if !ok {
+					return true
+				}
+				pname, ok := pkg.Info.Uses[id].(*types.PkgName)
+				if !ok || pname.Imported().Path() != b.srcPkg.PkgPath {
+					return true
+				}
+				newName, ok := b.renamed[pkg.Info.Uses[sel.Sel]]
+				if !ok {
+					return true
+				}
+				b.snap.ReplaceNode(sel, ast.NewIdent(newName))
+				return true
+			})
+		}
+	}
+}
+
+// declName returns the name and types.Object introduced by decl. It
+// expects decl to already introduce exactly one name: collectDecls
+// only calls it on the per-name declarations splitDecl produces, or on
+// a non-method *ast.FuncDecl, which only ever introduces one.
+func declName(pkg *refactor.Package, decl ast.Decl) (string, types.Object) {
+	switch d := decl.(type) {
+	case *ast.FuncDecl:
+		return d.Name.Name, pkg.Info.Defs[d.Name]
+	case *ast.GenDecl:
+		if len(d.Specs) != 1 {
+			return "", nil
+		}
+		switch s := d.Specs[0].(type) {
+		case *ast.TypeSpec:
+			return s.Name.Name, pkg.Info.Defs[s.Name]
+		case *ast.ValueSpec:
+			if len(s.Names) == 1 {
+				return s.Names[0].Name, pkg.Info.Defs[s.Names[0]]
+			}
+		}
+	}
+	return "", nil
+}
+
+func renameDecl(decl ast.Decl, name string) {
+	switch d := decl.(type) {
+	case *ast.FuncDecl:
+		d.Name.Name = name
+	case *ast.GenDecl:
+		switch s := d.Specs[0].(type) {
+		case *ast.TypeSpec:
+			s.Name.Name = name
+		case *ast.ValueSpec:
+			s.Names[0].Name = name
+		}
+	}
+}
@@ -0,0 +1,211 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"go/ast"
+	"go/token"
+	"strings"
+
+	"golang.org/x/tools/cover"
+
+	"rsc.io/rf/refactor"
+)
+
+// cmdCover implements the cover command.
+//
+// Usage:
+//
+//	cover profile.out [mark] [allow-exported]
+//
+// Cover loads a Go coverage profile and prunes code the profile shows is
+// dead. For every function in the snapshot's target packages whose
+// blocks are all uncovered, cover deletes the function, unless mark is
+// given, in which case it instead wraps the body in a "// rf: uncovered"
+// comment so a human can confirm the deletion. For a function with
+// mixed coverage, cover removes any if/else branch, or switch/type-switch
+// case, whose block has zero count while a sibling executed, simplifying
+// the surrounding control flow accordingly. A switch where every case is
+// uncovered is left alone, since that points at an untested type rather
+// than a single dead arm. Cover refuses to touch exported identifiers
+// unless allow-exported is given, since those may be called from outside
+// the packages the profile covers.
+//
+// This turns coverage data from a test run into a concrete, type-aware
+// refactoring step: the snapshot already has the full reference graph
+// needed to check that a deletion does not break remaining callers.
+func cmdCover(snap *refactor.Snapshot, text string) {
+	fields := strings.Fields(text)
+	if len(fields) == 0 {
+		snap.ErrorAt(token.NoPos, "usage: cover profile.out [mark] [allow-exported]")
+		return
+	}
+	profile := fields[0]
+	var mark, allowExported bool
+	for _, f := range fields[1:] {
+		switch f {
+		case "mark":
+			mark = true
+		case "allow-exported":
+			allowExported = true
+		default:
+			snap.ErrorAt(token.NoPos, "unknown cover option %q", f)
+			return
+		}
+	}
+
+	profiles, err := cover.ParseProfiles(profile)
+	if err != nil {
+		snap.ErrorAt(token.NoPos, "parsing coverage profile: %v", err)
+		return
+	}
+	byFile := make(map[string]*cover.Profile)
+	for _, p := range profiles {
+		byFile[p.FileName] = p
+	}
+
+	for _, pkg := range snap.TargetPackages() {
+		for _, file := range pkg.Files {
+			prof := findProfile(byFile, file.Name)
+			if prof == nil {
+				continue
+			}
+			pruneFile(snap, file, prof, mark, allowExported)
+		}
+	}
+}
+
+// findProfile looks up the *cover.Profile recorded for name, matching
+// on path suffix since profile file names are import-path-qualified
+// (for example "example.com/m/pkg/foo.go") while file.Name is a plain
+// OS path.
+func findProfile(byFile map[string]*cover.Profile, name string) *cover.Profile {
+	for profName, p := range byFile {
+		if strings.HasSuffix(name, profName) || strings.HasSuffix(profName, name) {
+			return p
+		}
+	}
+	return nil
+}
+
+// pruneFile deletes or marks every uncovered top-level function in
+// file, and removes unreachable branches of partially covered ones.
+func pruneFile(snap *refactor.Snapshot, file *refactor.File, prof *cover.Profile, mark, allowExported bool) {
+	fset := snap.Fset()
+	for _, decl := range file.Syntax.Decls {
+		fn, ok := decl.(*ast.FuncDecl)
+		if !ok || fn.Body == nil {
+			continue
+		}
+		if ast.IsExported(fn.Name.Name) && !allowExported {
+			continue
+		}
+
+		blocks := blocksIn(fset, prof, fn.Pos(), fn.End())
+		if len(blocks) == 0 {
+			continue
+		}
+		if allZero(blocks) {
+			if mark {
+				markUncovered(snap, file, fn)
+			} else {
+				snap.DeleteDecl(file, fn)
+			}
+			continue
+		}
+
+		pruneBranches(snap, file, fn, fset, prof)
+	}
+}
+
+// blocksIn returns the coverage blocks of prof whose span falls within
+// [start, end), translating token.Pos to the 1-based line numbers that
+// a cover.Profile records.
+func blocksIn(fset *token.FileSet, prof *cover.Profile, start, end token.Pos) []cover.ProfileBlock {
+	startLine := fset.Position(start).Line
+	endLine := fset.Position(end).Line
+
+	var blocks []cover.ProfileBlock
+	for _, b := range prof.Blocks {
+		if b.StartLine >= startLine && b.EndLine <= endLine {
+			blocks = append(blocks, b)
+		}
+	}
+	return blocks
+}
+
+func allZero(blocks []cover.ProfileBlock) bool {
+	for _, b := range blocks {
+		if b.Count > 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// markUncovered wraps fn's body in a "// rf: uncovered" marker comment
+// rather than deleting it, so a reviewer can confirm the function is
+// safe to remove before a later cover run (or manual edit) deletes it.
+func markUncovered(snap *refactor.Snapshot, file *refactor.File, fn *ast.FuncDecl) {
+	snap.AddComment(file, fn, "rf: uncovered")
+}
+
+// pruneBranches removes if/else and switch/type-switch branches of fn
+// whose blocks have zero count while a sibling branch executed, then
+// lets the surrounding control flow collapse: an if whose then-branch
+// is dead but whose else-branch ran becomes just the else-branch, an if
+// with no else and a dead then-branch is removed outright, a dead
+// else-branch is simply dropped, and a case clause whose body never ran
+// is deleted from its switch while sibling cases remain. An if whose
+// then and else are both dead is left alone, for the same reason
+// pruneCases leaves an all-dead switch alone: that points at a guard
+// never reached by any test, not at an untested arm of a live branch.
+func pruneBranches(snap *refactor.Snapshot, file *refactor.File, fn *ast.FuncDecl, fset *token.FileSet, prof *cover.Profile) {
+	ast.Inspect(fn.Body, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.IfStmt:
+			thenDead := allZero(blocksIn(fset, prof, n.Body.Pos(), n.Body.End()))
+			elseDead := n.Else != nil && allZero(blocksIn(fset, prof, n.Else.Pos(), n.Else.End()))
+
+			switch {
+			case thenDead && elseDead:
+				// Both branches dead; leave the statement alone.
+			case thenDead && n.Else != nil:
+				snap.ReplaceNode(n, n.Else)
+			case thenDead:
+				snap.DeleteStmt(file, n)
+			case elseDead:
+				snap.DeleteNode(n.Else)
+				n.Else = nil
+			}
+		case *ast.SwitchStmt:
+			pruneCases(snap, file, n.Body.List, fset, prof)
+		case *ast.TypeSwitchStmt:
+			pruneCases(snap, file, n.Body.List, fset, prof)
+		}
+		return true
+	})
+}
+
+// pruneCases deletes every *ast.CaseClause in clauses whose body has zero
+// count while at least one sibling clause executed, leaving a
+// switch/type-switch with uncovered cases entirely untouched rather than
+// guessing which of several dead cases, if any, is safe to drop.
+func pruneCases(snap *refactor.Snapshot, file *refactor.File, clauses []ast.Stmt, fset *token.FileSet, prof *cover.Profile) {
+	dead := make([]bool, len(clauses))
+	anyLive := false
+	for i, c := range clauses {
+		dead[i] = allZero(blocksIn(fset, prof, c.Pos(), c.End()))
+		anyLive = anyLive || !dead[i]
+	}
+	if !anyLive {
+		return
+	}
+	for i, c := range clauses {
+		if dead[i] {
+			snap.DeleteStmt(file, c)
+		}
+	}
+}
@@ -0,0 +1,236 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"go/token"
+	"go/types"
+	"sort"
+	"strings"
+
+	"golang.org/x/tools/go/callgraph/cha"
+	"golang.org/x/tools/go/ssa"
+	"golang.org/x/tools/go/ssa/ssautil"
+
+	"rsc.io/rf/refactor"
+)
+
+// cmdCallers implements the callers command.
+//
+// Usage:
+//
+//	callers pkg.Name
+//
+// Callers prints every static call site of the named function, found by
+// building a call graph (golang.org/x/tools/go/callgraph/cha) over the
+// snapshot's already-loaded packages.
+func cmdCallers(snap *refactor.Snapshot, text string) {
+	fn := lookupFunc(snap, text)
+	if fn == nil {
+		return
+	}
+	prog, fns := buildSSA(snap)
+	target := fns[fn]
+	if target == nil {
+		fmt.Fprintf(snap.Refactor().Stdout, "%s: no SSA function (unreachable or generic)\n", text)
+		return
+	}
+
+	cg := cha.CallGraph(prog)
+	var sites []string
+	if node := cg.Nodes[target]; node != nil {
+		for _, edge := range node.In {
+			pos := prog.Fset.Position(edge.Site.Pos())
+			sites = append(sites, fmt.Sprintf("%s: %s", pos, edge.Caller.Func))
+		}
+	}
+	printSorted(snap, sites, func(s string) string { return s })
+}
+
+// cmdCallees implements the callees command.
+//
+// Usage:
+//
+//	callees pkg.Name
+//
+// Callees prints every function that the named function may call,
+// according to the same class-hierarchy call graph used by callers.
+func cmdCallees(snap *refactor.Snapshot, text string) {
+	fn := lookupFunc(snap, text)
+	if fn == nil {
+		return
+	}
+	prog, fns := buildSSA(snap)
+	target := fns[fn]
+	if target == nil {
+		fmt.Fprintf(snap.Refactor().Stdout, "%s: no SSA function (unreachable or generic)\n", text)
+		return
+	}
+
+	cg := cha.CallGraph(prog)
+	seen := map[string]bool{}
+	var callees []string
+	if node := cg.Nodes[target]; node != nil {
+		for _, edge := range node.Out {
+			name := edge.Callee.Func.String()
+			if !seen[name] {
+				seen[name] = true
+				callees = append(callees, name)
+			}
+		}
+	}
+	printSorted(snap, callees, func(s string) string { return s })
+}
+
+// cmdImplements implements the implements command.
+//
+// Usage:
+//
+//	implements pkg.Type
+//
+// If pkg.Type is an interface, implements prints every concrete type in
+// the snapshot's target packages assignable to it; otherwise it prints every
+// interface that pkg.Type's type (or its pointer) is assignable to.
+// Assignability is decided with types.AssignableTo over the same
+// *types.Package graph the mutating commands already resolved.
+func cmdImplements(snap *refactor.Snapshot, text string) {
+	obj := lookupType(snap, text)
+	if obj == nil {
+		return
+	}
+	named, ok := obj.Type().(*types.Named)
+	if !ok {
+		fmt.Fprintf(snap.Refactor().Stdout, "%s: not a named type\n", text)
+		return
+	}
+
+	var matches []string
+	iface, isIface := named.Underlying().(*types.Interface)
+	for _, pkg := range snap.TargetPackages() {
+		scope := pkg.Types.Scope()
+		for _, name := range scope.Names() {
+			other, ok := scope.Lookup(name).(*types.TypeName)
+			if !ok || other == obj {
+				continue
+			}
+			ot := other.Type()
+			if isIface {
+				if types.IsInterface(ot) {
+					continue
+				}
+				if types.AssignableTo(ot, iface) || types.AssignableTo(types.NewPointer(ot), iface) {
+					matches = append(matches, pkg.PkgPath+"."+other.Name())
+				}
+			} else if oi, ok := ot.Underlying().(*types.Interface); ok {
+				if types.AssignableTo(named, oi) || types.AssignableTo(types.NewPointer(named), oi) {
+					matches = append(matches, pkg.PkgPath+"."+other.Name())
+				}
+			}
+		}
+	}
+	printSorted(snap, matches, func(s string) string { return s })
+}
+
+// cmdDescribe implements the describe command.
+//
+// Usage:
+//
+//	describe pkg.Name
+//
+// Describe prints the declaration, kind, and type of the named symbol:
+// a function's signature, a value's type and, for constants, its value,
+// or a type's underlying representation.
+func cmdDescribe(snap *refactor.Snapshot, text string) {
+	item := snap.Lookup(strings.TrimSpace(text))
+	if item == nil {
+		snap.ErrorAt(token.NoPos, "cannot find %s", text)
+		return
+	}
+	obj := item.Obj
+	out := snap.Refactor().Stdout
+	switch obj := obj.(type) {
+	case *types.Func:
+		fmt.Fprintf(out, "%s: func %s\n", text, obj.Type())
+	case *types.TypeName:
+		fmt.Fprintf(out, "%s: type %s\n", text, obj.Type().Underlying())
+	case *types.Const:
+		fmt.Fprintf(out, "%s: const %s = %s\n", text, obj.Type(), obj.Val())
+	case *types.Var:
+		fmt.Fprintf(out, "%s: var %s\n", text, obj.Type())
+	default:
+		fmt.Fprintf(out, "%s: %T\n", text, obj)
+	}
+}
+
+// lookupFunc resolves text to a *types.Func in the snapshot, reporting
+// an error and returning nil if text does not name a function.
+func lookupFunc(snap *refactor.Snapshot, text string) *types.Func {
+	item := snap.Lookup(strings.TrimSpace(text))
+	if item == nil {
+		snap.ErrorAt(token.NoPos, "cannot find %s", text)
+		return nil
+	}
+	fn, ok := item.Obj.(*types.Func)
+	if !ok {
+		snap.ErrorAt(token.NoPos, "%s is not a function", text)
+		return nil
+	}
+	return fn
+}
+
+// lookupType resolves text to a *types.TypeName in the snapshot,
+// reporting an error and returning nil if text does not name a type.
+func lookupType(snap *refactor.Snapshot, text string) *types.TypeName {
+	item := snap.Lookup(strings.TrimSpace(text))
+	if item == nil {
+		snap.ErrorAt(token.NoPos, "cannot find %s", text)
+		return nil
+	}
+	t, ok := item.Obj.(*types.TypeName)
+	if !ok {
+		snap.ErrorAt(token.NoPos, "%s is not a type", text)
+		return nil
+	}
+	return t
+}
+
+// buildSSA builds an SSA program over every package loaded into the
+// snapshot, returning it along with a map from *types.Func to the
+// corresponding *ssa.Function, for use by callers and callees.
+//
+// The map is populated from ssautil.AllFunctions, not pkg.Members: a
+// package's Members holds only its package-level funcs, vars, consts,
+// and types, never methods, so building it from Members alone left
+// every method query reporting no SSA function.
+func buildSSA(snap *refactor.Snapshot) (*ssa.Program, map[*types.Func]*ssa.Function) {
+	prog, _ := ssautil.AllPackages(snap.Packages(), 0)
+	prog.Build()
+
+	fns := make(map[*types.Func]*ssa.Function)
+	for fn := range ssautil.AllFunctions(prog) {
+		if obj, ok := fn.Object().(*types.Func); ok {
+			fns[obj] = fn
+		}
+	}
+	return prog, fns
+}
+
+// printSorted prints a sorted, de-duplicated list of lines to the
+// snapshot's configured output, one per line, or "(none)" if empty.
+func printSorted(snap *refactor.Snapshot, lines []string, key func(string) string) {
+	out := snap.Refactor().Stdout
+	if len(lines) == 0 {
+		fmt.Fprintln(out, "(none)")
+		return
+	}
+	sort.Slice(lines, func(i, j int) bool { return key(lines[i]) < key(lines[j]) })
+	for i, l := range lines {
+		if i > 0 && l == lines[i-1] {
+			continue
+		}
+		fmt.Fprintln(out, l)
+	}
+}
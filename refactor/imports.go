@@ -0,0 +1,157 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package refactor
+
+import (
+	"go/ast"
+	"go/types"
+
+	"golang.org/x/tools/go/ast/astutil"
+)
+
+// stdlibFallback lists standard-library import paths that Goimports may
+// add for an unresolved selector when the snapshot's own package graph
+// does not already have the defining package loaded (for example, a
+// command that introduces a call to fmt.Sprintf without importing fmt).
+// It is intentionally small: anything outside the standard library is
+// ambiguous without a module-aware search, so Goimports only guesses
+// for packages whose import path equals their package name, which
+// covers the overwhelming majority of stdlib imports users hit in
+// practice.
+var stdlibFallback = []string{
+	"bufio", "bytes", "context", "errors", "fmt", "io", "log", "math",
+	"os", "path", "regexp", "sort", "strconv", "strings", "sync", "time",
+	"unicode",
+}
+
+// Goimports runs a goimports-style import-hygiene pass over every file
+// in the snapshot's target packages, modified or not: it drops imports that are no longer
+// referenced and adds imports for selectors that type checking left
+// unresolved, so that commands like mv and inline do not routinely
+// leave a file with dangling or missing imports for the caller to fix
+// by hand.
+func (s *Snapshot) Goimports() {
+	for _, pkg := range s.TargetPackages() {
+		for _, file := range pkg.Files {
+			s.fixImports(pkg, file)
+		}
+	}
+}
+
+// fixImports drops file's unused imports and adds imports for any
+// selector expressions left unresolved by type checking.
+func (s *Snapshot) fixImports(pkg *Package, file *File) {
+	used := make(map[string]bool) // import path -> still referenced
+	for _, imp := range file.Syntax.Imports {
+		path := importPath(imp)
+		name := importName(pkg, imp)
+		if name == "_" || name == "." {
+			used[path] = true // never touch blank or dot imports
+			continue
+		}
+	}
+
+	ast.Inspect(file.Syntax, func(n ast.Node) bool {
+		id, ok := n.(*ast.Ident)
+		if !ok {
+			return true
+		}
+		if pname, ok := pkg.Info.Uses[id].(*types.PkgName); ok {
+			used[pname.Imported().Path()] = true
+		}
+		return true
+	})
+
+	var unused []*ast.ImportSpec
+	for _, imp := range file.Syntax.Imports {
+		if !used[importPath(imp)] {
+			unused = append(unused, imp)
+		}
+	}
+	for _, imp := range unused {
+		name := ""
+		if imp.Name != nil {
+			name = imp.Name.Name
+		}
+		astutil.DeleteNamedImport(s.Fset(), file.Syntax, name, importPath(imp))
+		s.InvalidateFile(file)
+	}
+
+	for _, sel := range unresolvedSelectors(pkg, file) {
+		if path := s.resolveImport(pkg, sel); path != "" {
+			astutil.AddImport(s.Fset(), file.Syntax, path)
+			s.InvalidateFile(file)
+		}
+	}
+}
+
+// unresolvedSelectors returns the package-qualifier identifiers (x in
+// x.Name) in file that type checking could not resolve to a
+// *types.PkgName, meaning the selector's base refers to an import that
+// is missing rather than one already in scope.
+func unresolvedSelectors(pkg *Package, file *File) []string {
+	var names []string
+	seen := map[string]bool{}
+	ast.Inspect(file.Syntax, func(n ast.Node) bool {
+		sel, ok := n.(*ast.SelectorExpr)
+		if !ok {
+			return true
+		}
+		id, ok := sel.X.(*ast.Ident)
+		if !ok {
+			return true
+		}
+		if pkg.Info.Uses[id] != nil || pkg.Info.Defs[id] != nil {
+			return true // already resolved (local var, type, or existing import)
+		}
+		if !seen[id.Name] {
+			seen[id.Name] = true
+			names = append(names, id.Name)
+		}
+		return true
+	})
+	return names
+}
+
+// resolveImport maps an unresolved package-qualifier name to an import
+// path, preferring a package already loaded into the snapshot (so that
+// Goimports picks up the user's own packages and their declared name,
+// which may differ from the path's last element) before falling back to
+// stdlibFallback.
+func (s *Snapshot) resolveImport(pkg *Package, name string) string {
+	for _, p := range s.Packages() {
+		if p.Types != nil && p.Types.Name() == name {
+			return p.PkgPath
+		}
+	}
+	for _, path := range stdlibFallback {
+		if path == name {
+			return path
+		}
+	}
+	return ""
+}
+
+// importPath returns the unquoted import path of imp.
+func importPath(imp *ast.ImportSpec) string {
+	s := imp.Path.Value
+	if len(s) >= 2 && s[0] == '"' && s[len(s)-1] == '"' {
+		return s[1 : len(s)-1]
+	}
+	return s
+}
+
+// importName returns the local name by which imp is referenced in pkg:
+// its explicit name if given, otherwise the name the imported package
+// declares for itself.
+func importName(pkg *Package, imp *ast.ImportSpec) string {
+	if imp.Name != nil {
+		return imp.Name.Name
+	}
+	if obj, ok := pkg.Info.Implicits[imp]; ok {
+		return obj.Name()
+	}
+	return ""
+}
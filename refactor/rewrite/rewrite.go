@@ -0,0 +1,373 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package rewrite implements gofmt -r style pattern rewrites:
+// purely syntactic, untyped substitutions of the form
+//
+//	pattern -> replacement
+//
+// where lowercase single-letter identifiers in the pattern are wildcards
+// that bind to arbitrary expressions. A wildcard that appears more than
+// once in the pattern must match identical (AST-equal) expressions at
+// every occurrence; the same wildcard may then be referenced any number
+// of times in the replacement.
+//
+// Unlike the rest of rf, package rewrite does no type checking: it is
+// meant for mechanical cleanups where a typed *refactor.Snapshot pattern
+// (see the ex command) would be overkill.
+package rewrite
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"reflect"
+	"strings"
+
+	"golang.org/x/tools/go/ast/astutil"
+)
+
+// A Rule is a parsed pattern -> replacement rewrite rule.
+type Rule struct {
+	Pattern     string
+	Replacement string
+	pattern     ast.Node
+	replace     ast.Node
+}
+
+// Parse parses a rule of the form "pattern -> replacement" and returns
+// the corresponding Rule. Both pattern and replacement are parsed as Go
+// expressions, falling back to statements (wrapped in a function body)
+// when they do not parse as expressions, so that rules such as
+//
+//	if a == nil { return b } -> return b
+//
+// are accepted alongside purely expression rules like
+//
+//	a[b:len(a)] -> a[b:]
+func Parse(rule string) (*Rule, error) {
+	pat, repl, ok := strings.Cut(rule, "->")
+	if !ok {
+		return nil, fmt.Errorf("rewrite rule must have form 'pattern -> replacement'")
+	}
+	pat, repl = strings.TrimSpace(pat), strings.TrimSpace(repl)
+
+	p, err := parseNode(pat)
+	if err != nil {
+		return nil, fmt.Errorf("parsing pattern: %v", err)
+	}
+	r, err := parseNode(repl)
+	if err != nil {
+		return nil, fmt.Errorf("parsing replacement: %v", err)
+	}
+	return &Rule{Pattern: pat, Replacement: repl, pattern: p, replace: r}, nil
+}
+
+// parseNode parses text first as an expression and, failing that, as a
+// statement list, returning whichever succeeds.
+func parseNode(text string) (ast.Node, error) {
+	if expr, err := parser.ParseExpr(text); err == nil {
+		return expr, nil
+	}
+	src := "package p\nfunc _() {\n" + text + "\n}\n"
+	file, err := parser.ParseFile(token.NewFileSet(), "", src, 0)
+	if err != nil {
+		return nil, err
+	}
+	body := file.Decls[0].(*ast.FuncDecl).Body
+	if len(body.List) == 1 {
+		return body.List[0], nil
+	}
+	return body, nil
+}
+
+// Apply rewrites every match of r.Pattern found in node to r.Replacement,
+// mutating node in place, and reports whether any rewrite was made.
+// Matching proceeds post-order, so that a pattern built from compound
+// expressions matches against already-rewritten children.
+func (r *Rule) Apply(node ast.Node) bool {
+	rewritten := false
+	post := func(c *astutil.Cursor) bool {
+		if repl := r.match(c.Node()); repl != nil {
+			c.Replace(repl)
+			rewritten = true
+		}
+		return true
+	}
+	astutil.Apply(node, nil, post)
+	return rewritten
+}
+
+// match reports whether n matches r.pattern and, if so, returns the
+// replacement with wildcard bindings substituted in.
+func (r *Rule) match(n ast.Node) ast.Node {
+	m := make(map[string]ast.Node)
+	if !matchNode(r.pattern, n, m) {
+		return nil
+	}
+	return substitute(r.replace, m)
+}
+
+// isWildcard reports whether name is a rewrite wildcard: a single
+// lowercase letter, following gofmt -r's convention.
+func isWildcard(name string) bool {
+	return len(name) == 1 && 'a' <= name[0] && name[0] <= 'z'
+}
+
+// matchNode reports whether n structurally matches pattern, binding any
+// wildcard identifiers in pattern into m. A wildcard that is already
+// bound must match an AST-equal node on subsequent occurrences.
+func matchNode(pattern, n ast.Node, m map[string]ast.Node) bool {
+	if pattern == nil || n == nil {
+		return pattern == nil && n == nil
+	}
+	if id, ok := pattern.(*ast.Ident); ok && isWildcard(id.Name) {
+		if prev, ok := m[id.Name]; ok {
+			return equalNode(prev, n)
+		}
+		m[id.Name] = n
+		return true
+	}
+
+	if reflect.TypeOf(pattern) != reflect.TypeOf(n) {
+		return false
+	}
+
+	pv := reflect.Indirect(reflect.ValueOf(pattern))
+	nv := reflect.Indirect(reflect.ValueOf(n))
+	return matchValue(pv, nv, m)
+}
+
+// posType is the reflect.Type of token.Pos, used to skip position-only
+// fields during matching and equality checks regardless of what the
+// field happens to be named: go/ast spells these NamePos, Lparen, Rbrack,
+// Lbrace, Ellipsis, Interface, Opening, and more, with no common naming
+// convention, so the only reliable test is the field's type.
+var posType = reflect.TypeOf(token.Pos(0))
+
+// matchValue walks the exported fields of two reflect.Values of the same
+// struct type (always an ast.Node concrete type reached from matchNode),
+// recursing into nested nodes, node slices, and scalar fields.
+func matchValue(pv, nv reflect.Value, m map[string]ast.Node) bool {
+	t := pv.Type()
+	for i := 0; i < t.NumField(); i++ {
+		if name := t.Field(i).Name; name == "Obj" {
+			continue
+		}
+		pf, nf := pv.Field(i), nv.Field(i)
+		if pf.Type() == posType {
+			continue
+		}
+		if !matchField(pf, nf, m) {
+			return false
+		}
+	}
+	return true
+}
+
+func matchField(pf, nf reflect.Value, m map[string]ast.Node) bool {
+	switch pf.Kind() {
+	case reflect.Interface:
+		pn, pok := pf.Interface().(ast.Node)
+		nn, nok := nf.Interface().(ast.Node)
+		if pf.IsNil() || nf.IsNil() {
+			return pf.IsNil() == nf.IsNil()
+		}
+		if !pok || !nok {
+			return reflect.DeepEqual(pf.Interface(), nf.Interface())
+		}
+		return matchNode(pn, nn, m)
+	case reflect.Ptr:
+		if pf.IsNil() || nf.IsNil() {
+			return pf.IsNil() == nf.IsNil()
+		}
+		pn, pok := pf.Interface().(ast.Node)
+		nn, nok := nf.Interface().(ast.Node)
+		if !pok || !nok {
+			return reflect.DeepEqual(pf.Interface(), nf.Interface())
+		}
+		return matchNode(pn, nn, m)
+	case reflect.Slice:
+		if pf.Len() != nf.Len() {
+			return false
+		}
+		for i := 0; i < pf.Len(); i++ {
+			if !matchField(pf.Index(i), nf.Index(i), m) {
+				return false
+			}
+		}
+		return true
+	default:
+		return reflect.DeepEqual(pf.Interface(), nf.Interface())
+	}
+}
+
+// equalNode reports whether two already-bound subtrees are structurally
+// identical apart from position information, for repeated-wildcard
+// consistency checks. Unlike matchNode, it treats every identifier
+// literally: a and b are concrete matched text, not patterns.
+func equalNode(a, b ast.Node) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	if reflect.TypeOf(a) != reflect.TypeOf(b) {
+		return false
+	}
+	return equalValue(reflect.Indirect(reflect.ValueOf(a)), reflect.Indirect(reflect.ValueOf(b)))
+}
+
+func equalValue(av, bv reflect.Value) bool {
+	switch av.Kind() {
+	case reflect.Struct:
+		t := av.Type()
+		for i := 0; i < t.NumField(); i++ {
+			if name := t.Field(i).Name; name == "Obj" {
+				continue
+			}
+			if av.Field(i).Type() == posType {
+				continue
+			}
+			if !equalValue(av.Field(i), bv.Field(i)) {
+				return false
+			}
+		}
+		return true
+	case reflect.Interface, reflect.Ptr:
+		if av.IsNil() || bv.IsNil() {
+			return av.IsNil() == bv.IsNil()
+		}
+		return equalNode(av.Interface().(ast.Node), bv.Interface().(ast.Node))
+	case reflect.Slice:
+		if av.Len() != bv.Len() {
+			return false
+		}
+		for i := 0; i < av.Len(); i++ {
+			if !equalValue(av.Index(i), bv.Index(i)) {
+				return false
+			}
+		}
+		return true
+	default:
+		return reflect.DeepEqual(av.Interface(), bv.Interface())
+	}
+}
+
+// substitute returns a copy of tmpl with every wildcard identifier bound
+// in m replaced by its bound node, and all positions reset so the result
+// prints using the replacement's own formatting, not the match site's.
+func substitute(tmpl ast.Node, m map[string]ast.Node) ast.Node {
+	out := substituteValue(reflect.ValueOf(tmpl), m).Interface().(ast.Node)
+	resetPos(out)
+	return out
+}
+
+// resetPos recursively zeroes every token.Pos field of n so that a
+// substituted tree is printed using fresh, relative positions rather
+// than whatever source offsets its pieces happened to carry.
+func resetPos(n ast.Node) {
+	v := reflect.Indirect(reflect.ValueOf(n))
+	resetPosValue(v)
+}
+
+func resetPosValue(v reflect.Value) {
+	switch v.Kind() {
+	case reflect.Struct:
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			if t.Field(i).Name == "Obj" {
+				continue // shared, not owned by this clone; see copyValue
+			}
+			f := v.Field(i)
+			if !f.CanSet() {
+				continue
+			}
+			if f.Type() == posType {
+				f.SetInt(0)
+				continue
+			}
+			resetPosValue(f)
+		}
+	case reflect.Ptr, reflect.Interface:
+		if !v.IsNil() {
+			resetPosValue(reflect.Indirect(v.Elem()))
+		}
+	case reflect.Slice:
+		for i := 0; i < v.Len(); i++ {
+			resetPosValue(reflect.Indirect(v.Index(i)))
+		}
+	}
+}
+
+func substituteValue(v reflect.Value, m map[string]ast.Node) reflect.Value {
+	if !v.IsValid() {
+		return v
+	}
+	if id, ok := v.Interface().(*ast.Ident); ok && isWildcard(id.Name) {
+		if bound, ok := m[id.Name]; ok {
+			return reflect.ValueOf(cloneNode(bound))
+		}
+	}
+	switch v.Kind() {
+	case reflect.Interface:
+		if v.IsNil() {
+			return v
+		}
+		return substituteValue(v.Elem(), m)
+	case reflect.Ptr:
+		if v.IsNil() {
+			return v
+		}
+		elem := reflect.Indirect(v)
+		clone := reflect.New(elem.Type())
+		copyValue(clone.Elem(), elem, m)
+		return clone
+	default:
+		clone := reflect.New(v.Type()).Elem()
+		copyValue(clone, v, m)
+		return clone
+	}
+}
+
+func copyValue(dst, src reflect.Value, m map[string]ast.Node) {
+	switch src.Kind() {
+	case reflect.Struct:
+		t := src.Type()
+		for i := 0; i < src.NumField(); i++ {
+			if !dst.Field(i).CanSet() {
+				continue
+			}
+			// *ast.Object's Decl can point back at the very *ast.Ident
+			// holding this field, so recursively cloning it would
+			// recurse forever; share the original Object instead, the
+			// way resetPosValue and the matcher already treat Obj as
+			// out of scope for structural work.
+			if t.Field(i).Name == "Obj" {
+				dst.Field(i).Set(src.Field(i))
+				continue
+			}
+			dst.Field(i).Set(substituteValue(src.Field(i), m).Convert(dst.Field(i).Type()))
+		}
+	case reflect.Slice:
+		if src.IsNil() {
+			return
+		}
+		out := reflect.MakeSlice(src.Type(), src.Len(), src.Len())
+		for i := 0; i < src.Len(); i++ {
+			out.Index(i).Set(substituteValue(src.Index(i), m).Convert(out.Index(i).Type()))
+		}
+		dst.Set(out)
+	case reflect.Interface, reflect.Ptr:
+		dst.Set(substituteValue(src, m).Convert(dst.Type()))
+	default:
+		dst.Set(src)
+	}
+}
+
+// cloneNode returns a deep copy of n. Position fields are copied as-is;
+// callers that need fresh positions reset them after cloning, the way
+// substitute does for a whole replacement tree via resetPos.
+func cloneNode(n ast.Node) ast.Node {
+	return substituteValue(reflect.ValueOf(n), map[string]ast.Node{}).Interface().(ast.Node)
+}
@@ -0,0 +1,75 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package rewrite
+
+import (
+	"bytes"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"testing"
+)
+
+// These cases mirror the classic gofmt -r rewrite test corpus
+// (cmd/gofmt/testdata/rewrite*), adapted to package rewrite's API.
+var rewriteTests = []struct {
+	rule    string
+	in, out string
+}{
+	{
+		rule: "a[b:len(a)] -> a[b:]",
+		in:   "package p\n\nfunc f(s []int, i int) []int { return s[i:len(s)] }\n",
+		out:  "package p\n\nfunc f(s []int, i int) []int { return s[i:] }\n",
+	},
+	{
+		rule: "interface{} -> any",
+		in:   "package p\n\nvar x interface{}\n",
+		out:  "package p\n\nvar x any\n",
+	},
+	{
+		rule: "fmt.Sprint(x) -> fmt.Sprintf(\"%v\", x)",
+		in:   "package p\n\nimport \"fmt\"\n\nvar s = fmt.Sprint(1)\n",
+		out:  "package p\n\nimport \"fmt\"\n\nvar s = fmt.Sprintf(\"%v\", 1)\n",
+	},
+	{
+		// b is used twice in the pattern and must bind to equal subtrees.
+		rule: "min(b, b) -> b",
+		in:   "package p\n\nvar x = min(f(1), f(1))\n",
+		out:  "package p\n\nvar x = f(1)\n",
+	},
+	{
+		// b differs between occurrences, so the rule must not fire.
+		rule: "min(b, b) -> b",
+		in:   "package p\n\nvar x = min(f(1), f(2))\n",
+		out:  "package p\n\nvar x = min(f(1), f(2))\n",
+	},
+}
+
+func TestApply(t *testing.T) {
+	for _, tt := range rewriteTests {
+		t.Run(tt.rule, func(t *testing.T) {
+			r, err := Parse(tt.rule)
+			if err != nil {
+				t.Fatalf("Parse(%q): %v", tt.rule, err)
+			}
+
+			fset := token.NewFileSet()
+			file, err := parser.ParseFile(fset, "in.go", tt.in, parser.ParseComments)
+			if err != nil {
+				t.Fatalf("parsing input: %v", err)
+			}
+
+			r.Apply(file)
+
+			var buf bytes.Buffer
+			if err := format.Node(&buf, fset, file); err != nil {
+				t.Fatalf("formatting result: %v", err)
+			}
+			if got := buf.String(); got != tt.out {
+				t.Errorf("Apply(%q) =\n%s\nwant:\n%s", tt.rule, got, tt.out)
+			}
+		})
+	}
+}
@@ -0,0 +1,169 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package refactor
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// A Loader produces a Snapshot, either from disk (a *Refactor) or from
+// the result of the previous command (a *Snapshot), so that RunScript
+// can feed each successive command the latest state without caring
+// which kind of base it started from.
+type Loader interface {
+	Load() (*Snapshot, error)
+}
+
+// Cmds maps a script command name, such as "mv" or "rm", to the
+// function that implements it. A command mutates the *Snapshot it is
+// given according to the text following the command name on its script
+// line.
+type Cmds map[string]func(*Snapshot, string)
+
+// RunScript executes script, a newline-separated sequence of rf
+// commands, against rf, applying cmds to resolve each command name to
+// an implementation. It is the shared engine behind the rf command line
+// tool and package scripttest's txtar-driven tests: both need to run a
+// script against a snapshot and observe the resulting files or errors,
+// so the loop lives here rather than in main so it can be called
+// without spawning a subprocess.
+func RunScript(rf *Refactor, cmds Cmds, script string) error {
+	var base Loader = rf
+	var snap *Snapshot
+
+	text := script
+	lastCmd := ""
+	for text != "" {
+		var line string
+		line, text, _ = cutLine(text, "\n")
+		line = trimScriptComments(line)
+		for strings.HasSuffix(line, `\`) && text != "" {
+			var l string
+			l, text, _ = cutLine(text, "\n")
+			line = line[:len(line)-1] + "\n" + l
+			line = trimScriptComments(line)
+		}
+		line = strings.TrimLeft(line, " \t\n")
+		if line == "" {
+			continue
+		}
+		cmd, args, _ := cutAnyLine(line, " \t")
+
+		if rf.Debug["trace"] != "" {
+			fmt.Fprintf(os.Stderr, "> %s\n", strings.ReplaceAll(line, "\n", "\\\n"))
+		}
+
+		fn := cmds[cmd]
+		if fn == nil {
+			return fmt.Errorf("unknown command %s", cmd)
+		}
+
+		var err error
+		snap, err = base.Load()
+		if err != nil {
+			return err
+		}
+		if snap.Errors() > 0 {
+			if lastCmd == "" {
+				return fmt.Errorf("errors found before executing script")
+			}
+			base := base.(*Snapshot)
+			if rf.ShowDiff {
+				if d, err := base.Diff(); err == nil {
+					rf.Stdout.Write(d)
+				}
+			} else {
+				base.Write()
+			}
+			return fmt.Errorf("errors found after executing: %s", lastCmd)
+		}
+		x, _, ok := cutLine(line, "\n")
+		if ok {
+			x += " \\ ..."
+		}
+		lastCmd = x
+
+		targ := snap.Target()
+		if targ.Types == nil {
+			println("TARG", targ, targ.PkgPath)
+			panic("no types in target")
+		}
+
+		fn(snap, args)
+		if snap.Errors() > 0 {
+			return err
+		}
+
+		snap.Gofmt()
+		snap.Goimports()
+		base = snap
+	}
+
+	if snap == nil {
+		// Did nothing.
+		return nil
+	}
+
+	// Show diff before final load, so that it's easier to understand errors.
+	if rf.ShowDiff {
+		d, err := snap.Diff()
+		if err != nil {
+			return err
+		}
+		rf.Stdout.Write(d)
+	}
+
+	// Reload packages one last time before writing,
+	// to make sure the rewrites are valid.
+	if _, err := snap.Load(); err != nil {
+		return fmt.Errorf("checking rewritten packages: %v", err)
+	}
+
+	if rf.ShowDiff {
+		return nil
+	}
+
+	return snap.Write()
+}
+
+func cutLine(s, sep string) (before, after string, ok bool) {
+	if i := strings.Index(s, sep); i >= 0 {
+		return s[:i], s[i+len(sep):], true
+	}
+	return s, "", false
+}
+
+func cutAnyLine(s, any string) (before, after string, ok bool) {
+	if i := strings.IndexAny(s, any); i >= 0 {
+		return s[:i], s[i+1:], true
+	}
+	return s, "", false
+}
+
+// trimScriptComments cuts line at a # comment, being careful not to cut
+// inside quoted text, mirroring the comment syntax accepted by script
+// lines themselves.
+func trimScriptComments(line string) string {
+	var q byte
+	for i := 0; i < len(line); i++ {
+		switch c := line[i]; c {
+		case q:
+			q = 0
+		case '\'', '"', '`':
+			q = c
+		case '\\':
+			if q == '\'' || q == '"' {
+				i++
+			}
+		case '#':
+			if q == 0 {
+				line = line[:i]
+			}
+		}
+	}
+	return strings.TrimSpace(line)
+}
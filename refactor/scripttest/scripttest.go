@@ -0,0 +1,136 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package scripttest runs rf scripts recorded as txtar archives and
+// checks their effect on a set of source files, the way
+// github.com/rogpeppe/go-internal/testscript runs shell-like scripts
+// against a temporary GOPATH.
+//
+// Each test is a single txtar archive (see golang.org/x/tools/txtar)
+// containing the module to refactor, a "script" section holding the rf
+// commands to run, and either a "want/..." section per file describing
+// its expected post-refactor contents or a "diff" section describing
+// the expected unified diff. The "diff" section is compared with the
+// run's whole standard output, so it also holds whatever query commands
+// such as callees print. This lets a regression test for a single
+// rf command live as one self-contained file, instead of requiring a
+// hand-written Go test that pokes at a *refactor.Snapshot directly.
+package scripttest
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/rogpeppe/go-internal/diff"
+	"golang.org/x/tools/txtar"
+
+	"rsc.io/rf/refactor"
+)
+
+// Test runs every *.txtar file in dir as a subtest, executing its
+// script against the files the archive describes and using cmds to
+// resolve script command names, exactly as the rf binary's own cmds
+// map does. Callers pass their own cmds map (rather than scripttest
+// depending on package main) so that package main can add this test
+// without creating an import cycle.
+func Test(t *testing.T, dir string, cmds refactor.Cmds) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.txtar"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) == 0 {
+		t.Fatalf("no *.txtar files found in %s", dir)
+	}
+	for _, file := range files {
+		file := file
+		name := strings.TrimSuffix(filepath.Base(file), ".txtar")
+		t.Run(name, func(t *testing.T) {
+			runArchive(t, file, cmds)
+		})
+	}
+}
+
+func runArchive(t *testing.T, file string, cmds refactor.Cmds) {
+	a, err := txtar.ParseFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var script string
+	want := make(map[string][]byte)
+	var wantDiff []byte
+	haveScript := false
+	for _, f := range a.Files {
+		switch {
+		case f.Name == "script":
+			script = string(f.Data)
+			haveScript = true
+		case f.Name == "diff":
+			wantDiff = f.Data
+		case strings.HasPrefix(f.Name, "want/"):
+			want[strings.TrimPrefix(f.Name, "want/")] = f.Data
+		}
+	}
+	if !haveScript {
+		t.Fatalf("%s: missing -- script -- section", file)
+	}
+
+	dir := t.TempDir()
+	for _, f := range a.Files {
+		if f.Name == "script" || f.Name == "diff" || strings.HasPrefix(f.Name, "want/") {
+			continue
+		}
+		path := filepath.Join(dir, f.Name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o777); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, f.Data, 0o666); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	rf, err := refactor.New(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rf.ShowDiff = wantDiff != nil
+
+	var stdout strings.Builder
+	rf.Stdout = &stdout
+
+	// File names in script arguments, such as cover's profile, are
+	// relative to the archive's root, so run the script from there.
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+
+	if err := refactor.RunScript(rf, cmds, script); err != nil {
+		t.Fatalf("running script: %v", err)
+	}
+
+	if wantDiff != nil {
+		if got := stdout.String(); got != string(wantDiff) {
+			t.Errorf("diff mismatch:\n%s", diff.Diff("want", wantDiff, "got", []byte(got)))
+		}
+		return
+	}
+
+	for name, data := range want {
+		got, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			t.Errorf("reading %s after script: %v", name, err)
+			continue
+		}
+		if string(got) != string(data) {
+			t.Errorf("%s mismatch:\n%s", name, diff.Diff("want", data, "got", got))
+		}
+	}
+}
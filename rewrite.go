@@ -0,0 +1,42 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"go/token"
+
+	"rsc.io/rf/refactor"
+	"rsc.io/rf/refactor/rewrite"
+)
+
+// cmdRewrite implements the rewrite command.
+//
+// Usage:
+//
+//	rewrite 'pattern -> replacement'
+//
+// Rewrite applies a gofmt -r style pattern rewrite to every file in the
+// snapshot's target packages. Lowercase single-letter identifiers in
+// pattern are wildcards that bind to arbitrary expressions on first use
+// and must match an identical expression on any repeat use; the same
+// wildcards may appear any number of times in replacement.
+//
+// Unlike ex, rewrite does no type checking: it is a purely syntactic,
+// structural match over the parsed AST.
+func cmdRewrite(snap *refactor.Snapshot, text string) {
+	rule, err := rewrite.Parse(text)
+	if err != nil {
+		snap.ErrorAt(token.NoPos, "%v", err)
+		return
+	}
+
+	for _, pkg := range snap.TargetPackages() {
+		for _, file := range pkg.Files {
+			if rule.Apply(file.Syntax) {
+				snap.InvalidateFile(file)
+			}
+		}
+	}
+}
@@ -40,121 +40,26 @@ func main() {
 		log.Fatal(err)
 	}
 	rf.ShowDiff = *showDiff
-	if err := run(rf, script); err != nil {
+	if err := refactor.RunScript(rf, cmds, script); err != nil {
 		log.Fatal(err)
 	}
 }
 
-var cmds = map[string]func(*refactor.Snapshot, string){
-	"add":    cmdAdd,
-	"debug":  cmdDebug,
-	"inline": cmdInline,
-	"key":    cmdKey,
-	"ex":     cmdEx,
-	"mv":     cmdMv,
-	"rm":     cmdRm,
-}
-
-type loader interface {
-	Load() (*refactor.Snapshot, error)
-}
-
-func run(rf *refactor.Refactor, script string) error {
-	var base loader = rf
-	var snap *refactor.Snapshot
-
-	text := script
-	lastCmd := ""
-	for text != "" {
-		var line string
-		line, text, _ = cut(text, "\n")
-		line = trimComments(line)
-		for strings.HasSuffix(line, `\`) && text != "" {
-			var l string
-			l, text, _ = cut(text, "\n")
-			line = line[:len(line)-1] + "\n" + l
-			line = trimComments(line)
-		}
-		line = strings.TrimLeft(line, " \t\n")
-		if line == "" {
-			continue
-		}
-		cmd, args, _ := cutAny(line, " \t")
-
-		if rf.Debug["trace"] != "" {
-			fmt.Fprintf(os.Stderr, "> %s\n", strings.ReplaceAll(line, "\n", "\\\n"))
-		}
-
-		fn := cmds[cmd]
-		if fn == nil {
-			return fmt.Errorf("unknown command %s", cmd)
-		}
-
-		var err error
-		snap, err = base.Load()
-		if err != nil {
-			return err
-		}
-		if snap.Errors() > 0 {
-			if lastCmd == "" {
-				return fmt.Errorf("errors found before executing script")
-			}
-			base := base.(*refactor.Snapshot)
-			if rf.ShowDiff {
-				if d, err := base.Diff(); err == nil {
-					rf.Stdout.Write(d)
-				}
-			} else {
-				base.Write()
-			}
-			return fmt.Errorf("errors found after executing: %s", lastCmd)
-		}
-		x, _, ok := cut(line, "\n")
-		if ok {
-			x += " \\ ..."
-		}
-		lastCmd = x
-
-		targ := snap.Target()
-		if targ.Types == nil {
-			println("TARG", targ, targ.PkgPath)
-			panic("no types in target")
-		}
-
-		fn(snap, args)
-		if snap.Errors() > 0 {
-			return err
-		}
-
-		snap.Gofmt()
-		base = snap
-	}
-
-	if snap == nil {
-		// Did nothing.
-		return nil
-	}
-
-	// Show diff before final load, so that it's easier to understand errors.
-	if rf.ShowDiff {
-		d, err := snap.Diff()
-		if err != nil {
-			return err
-		}
-		rf.Stdout.Write(d)
-	}
-
-	// Reload packages one last time before writing,
-	// to make sure the rewrites are valid.
-	if _, err := snap.Load(); err != nil {
-		return fmt.Errorf("checking rewritten packages: %v", err)
-	}
-
-	if rf.ShowDiff {
-		return nil
-	}
-
-	return snap.Write()
+var cmds = refactor.Cmds{
+	"add":        cmdAdd,
+	"bundle":     cmdBundle,
+	"callees":    cmdCallees,
+	"callers":    cmdCallers,
+	"cover":      cmdCover,
+	"debug":      cmdDebug,
+	"describe":   cmdDescribe,
+	"implements": cmdImplements,
+	"inline":     cmdInline,
+	"key":        cmdKey,
+	"ex":         cmdEx,
+	"mv":         cmdMv,
+	"rewrite":    cmdRewrite,
+	"rm":         cmdRm,
 }
 
 func trimComments(line string) string {
@@ -0,0 +1,18 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"testing"
+
+	"rsc.io/rf/refactor/scripttest"
+)
+
+// TestScripts runs every txtar archive under testdata/script as an
+// end-to-end test of an rf script, using the same cmds map as the rf
+// binary itself.
+func TestScripts(t *testing.T) {
+	scripttest.Test(t, "testdata/script", cmds)
+}